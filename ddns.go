@@ -0,0 +1,161 @@
+package main
+
+// Dynamic-DNS mode: keep a single A/AAAA record pointed at this host's
+// current public IP, so route53-zone can run as a lightweight ddclient
+// replacement without a YAML config.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+// ddnsState is the JSON state persisted to -ddns-state so a restart doesn't
+// issue a redundant UPSERT when the public IP hasn't changed.
+type ddnsState struct {
+	IP string `json:"IP"`
+}
+
+// runDDNS resolves the host's current public IP and, when it differs from
+// the last-applied address, upserts -ddns-name to it. With -ddns-once it
+// checks a single time and returns, for driving from cron; otherwise it
+// polls every -ddns-interval (plus up to -ddns-jitter of random slack, to
+// avoid every host in a fleet hitting the resolver at once).
+func runDDNS() {
+
+	if ddnsName == "" {
+		log.Fatalf("-ddns-name is required for -ddns")
+	}
+	if ddnsZoneID == "" {
+		log.Fatalf("-ddns-zoneid is required for -ddns")
+	}
+	if ddnsType != "A" && ddnsType != "AAAA" {
+		log.Fatalf("-ddns-type must be A or AAAA, got %s", ddnsType)
+	}
+
+	interval, err := time.ParseDuration(ddnsInterval)
+	if err != nil {
+		log.Fatalf("invalid -ddns-interval %s with error: %s", ddnsInterval, err)
+	}
+	jitter, err := time.ParseDuration(ddnsJitter)
+	if err != nil {
+		log.Fatalf("invalid -ddns-jitter %s with error: %s", ddnsJitter, err)
+	}
+
+	prov, _ := newProvider(providerName, &route53Zone{ZoneID: ddnsZoneID, Name: ddnsName})
+
+	for {
+		if err := ddnsCheckAndUpdate(prov); err != nil {
+			log.Printf("Error checking/updating ddns record: %s", err)
+		}
+
+		if ddnsOnce {
+			return
+		}
+
+		time.Sleep(interval + time.Duration(rand.Int63n(int64(jitter)+1)))
+	}
+}
+
+// ddnsCheckAndUpdate resolves the current public IP and upserts it to
+// ddnsName if it differs from the IP recorded in ddnsStateFile.
+func ddnsCheckAndUpdate(prov provider.Provider) error {
+
+	ip, err := resolvePublicIP(ddnsResolver)
+	if err != nil {
+		return fmt.Errorf("error resolving public IP from %s: %s", ddnsResolver, err)
+	}
+
+	last, err := readDDNSState(ddnsStateFile)
+	if err != nil {
+		return fmt.Errorf("error reading ddns state file %s: %s", ddnsStateFile, err)
+	}
+
+	if last.IP == ip {
+		return nil
+	}
+
+	change := provider.Change{
+		Action: provider.ChangeActionUpsert,
+		Record: provider.Record{
+			Name:   ddnsName,
+			Type:   ddnsType,
+			TTL:    ddnsTTL,
+			Values: []string{ip},
+		},
+	}
+
+	if _, err := prov.ApplyChanges(ddnsZoneID, []provider.Change{change}); err != nil {
+		return fmt.Errorf("error applying ddns change: %s", err)
+	}
+
+	if err := writeDDNSState(ddnsStateFile, ddnsState{IP: ip}); err != nil {
+		return fmt.Errorf("error writing ddns state file %s: %s", ddnsStateFile, err)
+	}
+
+	fmt.Printf("ddns: updated %s %s to %s\n", ddnsName, ddnsType, ip)
+
+	return nil
+}
+
+// resolvePublicIP fetches the host's public IP as plain text from resolver,
+// e.g. https://checkip.amazonaws.com.
+func resolvePublicIP(resolver string) (string, error) {
+
+	resp, err := http.Get(resolver)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s from %s", resp.Status, resolver)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// readDDNSState loads the last-applied IP from path. A missing file is not
+// an error: it just means no IP has been applied yet.
+func readDDNSState(path string) (ddnsState, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ddnsState{}, nil
+		}
+		return ddnsState{}, err
+	}
+
+	var s ddnsState
+	if err := json.Unmarshal(content, &s); err != nil {
+		return ddnsState{}, err
+	}
+
+	return s, nil
+}
+
+// writeDDNSState persists the last-applied IP to path so a restart doesn't
+// issue a redundant UPSERT.
+func writeDDNSState(path string, s ddnsState) error {
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+// fakeProvider is a minimal provider.Provider for exercising ddnsCheckAndUpdate
+// without talking to a real DNS backend.
+type fakeProvider struct {
+	applyErr error
+	applied  []provider.Change
+}
+
+func (p *fakeProvider) ListZones() ([]provider.Zone, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) ListRecords(zoneID string) ([]provider.Record, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) ApplyChanges(zoneID string, changes []provider.Change) (string, error) {
+	if p.applyErr != nil {
+		return "", p.applyErr
+	}
+	p.applied = append(p.applied, changes...)
+	return "", nil
+}
+
+func TestResolvePublicIP(t *testing.T) {
+	t.Run("returns trimmed body on 200", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, " 203.0.113.7 ")
+		}))
+		defer srv.Close()
+
+		ip, err := resolvePublicIP(srv.URL)
+		if err != nil {
+			t.Fatalf("resolvePublicIP returned error: %s", err)
+		}
+		if ip != "203.0.113.7" {
+			t.Errorf("ip = %q, want %q", ip, "203.0.113.7")
+		}
+	})
+
+	t.Run("non-200 status is an error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		if _, err := resolvePublicIP(srv.URL); err == nil {
+			t.Error("expected an error for a non-200 response, got nil")
+		}
+	})
+
+	t.Run("unreachable resolver is an error", func(t *testing.T) {
+		if _, err := resolvePublicIP("http://127.0.0.1:0"); err == nil {
+			t.Error("expected an error for an unreachable resolver, got nil")
+		}
+	})
+}
+
+func TestReadDDNSState(t *testing.T) {
+	t.Run("missing file returns zero state, no error", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ddns-test")
+		if err != nil {
+			t.Fatalf("error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		s, err := readDDNSState(filepath.Join(dir, "missing.json"))
+		if err != nil {
+			t.Fatalf("readDDNSState returned error: %s", err)
+		}
+		if s.IP != "" {
+			t.Errorf("IP = %q, want empty", s.IP)
+		}
+	})
+
+	t.Run("round-trips a written state", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ddns-test")
+		if err != nil {
+			t.Fatalf("error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "state.json")
+		if err := writeDDNSState(path, ddnsState{IP: "203.0.113.7"}); err != nil {
+			t.Fatalf("writeDDNSState returned error: %s", err)
+		}
+
+		s, err := readDDNSState(path)
+		if err != nil {
+			t.Fatalf("readDDNSState returned error: %s", err)
+		}
+		if s.IP != "203.0.113.7" {
+			t.Errorf("IP = %q, want %q", s.IP, "203.0.113.7")
+		}
+	})
+
+	t.Run("malformed state file is an error", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ddns-test")
+		if err != nil {
+			t.Fatalf("error creating temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "state.json")
+		if err := ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+			t.Fatalf("error writing test state file: %s", err)
+		}
+
+		if _, err := readDDNSState(path); err == nil {
+			t.Error("expected an error for a malformed state file, got nil")
+		}
+	})
+}
+
+func TestDdnsCheckAndUpdate(t *testing.T) {
+	origResolver := ddnsResolver
+	origName := ddnsName
+	origType := ddnsType
+	origTTL := ddnsTTL
+	origZoneID := ddnsZoneID
+	origStateFile := ddnsStateFile
+	defer func() {
+		ddnsResolver = origResolver
+		ddnsName = origName
+		ddnsType = origType
+		ddnsTTL = origTTL
+		ddnsZoneID = origZoneID
+		ddnsStateFile = origStateFile
+	}()
+
+	dir, err := ioutil.TempDir("", "ddns-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer srv.Close()
+
+	ddnsResolver = srv.URL
+	ddnsName = "host.example.com."
+	ddnsType = "A"
+	ddnsTTL = 300
+	ddnsZoneID = "Z1"
+	ddnsStateFile = filepath.Join(dir, "state.json")
+
+	t.Run("applies a change and persists state when the IP is new", func(t *testing.T) {
+		prov := &fakeProvider{}
+
+		if err := ddnsCheckAndUpdate(prov); err != nil {
+			t.Fatalf("ddnsCheckAndUpdate returned error: %s", err)
+		}
+
+		if len(prov.applied) != 1 {
+			t.Fatalf("expected 1 applied change, got %d", len(prov.applied))
+		}
+		got := prov.applied[0]
+		if got.Action != provider.ChangeActionUpsert || got.Record.Name != ddnsName || got.Record.Values[0] != "203.0.113.7" {
+			t.Errorf("unexpected applied change: %+v", got)
+		}
+
+		s, err := readDDNSState(ddnsStateFile)
+		if err != nil {
+			t.Fatalf("readDDNSState returned error: %s", err)
+		}
+		if s.IP != "203.0.113.7" {
+			t.Errorf("persisted IP = %q, want %q", s.IP, "203.0.113.7")
+		}
+	})
+
+	t.Run("skips ApplyChanges when the IP hasn't changed", func(t *testing.T) {
+		if err := writeDDNSState(ddnsStateFile, ddnsState{IP: "203.0.113.7"}); err != nil {
+			t.Fatalf("writeDDNSState returned error: %s", err)
+		}
+
+		prov := &fakeProvider{}
+
+		if err := ddnsCheckAndUpdate(prov); err != nil {
+			t.Fatalf("ddnsCheckAndUpdate returned error: %s", err)
+		}
+
+		if len(prov.applied) != 0 {
+			t.Errorf("expected no applied changes for an unchanged IP, got %d", len(prov.applied))
+		}
+	})
+
+	t.Run("ApplyChanges error is surfaced without updating state", func(t *testing.T) {
+		if err := writeDDNSState(ddnsStateFile, ddnsState{IP: "198.51.100.1"}); err != nil {
+			t.Fatalf("writeDDNSState returned error: %s", err)
+		}
+
+		prov := &fakeProvider{applyErr: fmt.Errorf("boom")}
+
+		if err := ddnsCheckAndUpdate(prov); err == nil {
+			t.Error("expected an error when ApplyChanges fails, got nil")
+		}
+
+		s, err := readDDNSState(ddnsStateFile)
+		if err != nil {
+			t.Fatalf("readDDNSState returned error: %s", err)
+		}
+		if s.IP != "198.51.100.1" {
+			t.Errorf("state should be unchanged after a failed apply, got %q", s.IP)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+// Package provider defines the DNS backend abstraction used by route53-zone
+// so the same YAML configuration can be diffed and applied against Route53
+// or any other supported DNS source.
+package provider
+
+// ChangeAction describes the mutation a Change applies to a zone.
+type ChangeAction string
+
+// The set of change actions a Provider must support.
+const (
+	ChangeActionCreate ChangeAction = "CREATE"
+	ChangeActionUpsert ChangeAction = "UPSERT"
+	ChangeActionDelete ChangeAction = "DELETE"
+)
+
+// AliasTarget is a provider-agnostic alias/CNAME-flattening target, modeled
+// after Route53's AliasTarget.
+type AliasTarget struct {
+	HostedZoneID         string
+	DNSName              string
+	EvaluateTargetHealth bool
+}
+
+// GeoLocation is a provider-agnostic geolocation routing target.
+type GeoLocation struct {
+	ContinentCode   string
+	CountryCode     string
+	SubdivisionCode string
+}
+
+// Record is a single DNS resource record, independent of any backend's wire
+// format. SetIdentifier, Weight, Region, GeoLocation and Failover describe a
+// routing policy; backends that don't support routing policies ignore them.
+type Record struct {
+	Name          string
+	Type          string
+	TTL           int64
+	Values        []string
+	AliasTarget   *AliasTarget
+	SetIdentifier string
+	Weight        *int64
+	Region        string
+	GeoLocation   *GeoLocation
+	Failover      string
+	HealthCheckID string
+}
+
+// Change pairs an action with the record it applies to.
+type Change struct {
+	Action ChangeAction
+	Record Record
+}
+
+// Zone is a provider-agnostic hosted zone summary.
+type Zone struct {
+	ID   string
+	Name string
+}
+
+// Provider abstracts a DNS backend. Implementations live under providers/,
+// one package per backend (e.g. providers/route53, providers/bind).
+type Provider interface {
+	// ListZones returns the zones visible to this provider.
+	ListZones() ([]Zone, error)
+
+	// ListRecords returns every record currently in the zone identified by zoneID.
+	ListRecords(zoneID string) ([]Record, error)
+
+	// ApplyChanges submits a batch of changes to the zone identified by zoneID.
+	// It returns a backend-specific change id (empty if the backend has no
+	// concept of one) that a ChangeWaiter can use to wait for propagation.
+	ApplyChanges(zoneID string, changes []Change) (changeID string, err error)
+}
+
+// ChangeWaiter is implemented by providers whose changes propagate
+// asynchronously, so callers can block until a change batch has taken effect
+// before submitting a dependent batch.
+type ChangeWaiter interface {
+	WaitForChange(changeID string) error
+}
@@ -0,0 +1,207 @@
+// Package bindprovider implements the provider.Provider interface against a
+// plain RFC 1035 BIND zonefile, so a YAML config can be diffed against a
+// non-AWS source. It supports the record shapes route53-zone itself
+// generates: A/AAAA/CNAME/TXT/MX with a Name, TTL and one or more values.
+// SOA and NS records in the zonefile are skipped when it is read. It does not
+// support Route53 routing policies or alias targets, since plain zonefiles
+// have no equivalent.
+package bindprovider
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+// BindProvider reads and writes a single zonefile on disk. Its "zone id" is
+// the zonefile path, and it always reports exactly one zone.
+type BindProvider struct {
+	zoneFilePath string
+	origin       string
+}
+
+// New returns a BindProvider for the zonefile at path. origin is the zone's
+// apex name (e.g. "example.com."), used when the file has no $ORIGIN line.
+func New(path string, origin string) *BindProvider {
+	return &BindProvider{zoneFilePath: path, origin: origin}
+}
+
+// ListZones reports the single zone backed by this provider's zonefile.
+func (p *BindProvider) ListZones() ([]provider.Zone, error) {
+	return []provider.Zone{{ID: p.zoneFilePath, Name: p.origin}}, nil
+}
+
+// ListRecords parses the zonefile into provider-agnostic records.
+func (p *BindProvider) ListRecords(zoneID string) ([]provider.Record, error) {
+
+	f, err := os.Open(zoneID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []provider.Record
+	index := make(map[string]int)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "$ORIGIN") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 {
+				p.origin = fields[1]
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "$TTL") {
+			continue
+		}
+
+		rec, err := parseRecordLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing zonefile %s: %s", zoneID, err)
+		}
+		if rec == nil {
+			continue
+		}
+
+		// Multiple lines sharing a Name/Type (e.g. round-robin A records) are one
+		// logical record with several values, not several records
+		key := recordKey(*rec)
+		if i, ok := index[key]; ok {
+			records[i].Values = append(records[i].Values, rec.Values...)
+			continue
+		}
+		index[key] = len(records)
+		records = append(records, *rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// parseRecordLine parses a single RFC 1035 resourcerecord line of the form:
+//
+//	name TTL [IN] TYPE value
+//
+// SOA/NS authority records are skipped, mirroring how route53-zone treats
+// them for Route53.
+func parseRecordLine(line string) (*provider.Record, error) {
+
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("malformed record line: %q", line)
+	}
+
+	name := fields[0]
+	ttl, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TTL in line %q: %s", line, err)
+	}
+
+	rest := fields[2:]
+	if strings.EqualFold(rest[0], "IN") {
+		rest = rest[1:]
+	}
+	if len(rest) < 2 {
+		return nil, fmt.Errorf("malformed record line: %q", line)
+	}
+
+	recordType := strings.ToUpper(rest[0])
+	value := strings.Join(rest[1:], " ")
+
+	if recordType == "SOA" || recordType == "NS" {
+		return nil, nil
+	}
+
+	return &provider.Record{
+		Name:   name,
+		Type:   recordType,
+		TTL:    ttl,
+		Values: []string{value},
+	}, nil
+}
+
+// ApplyChanges applies CREATE/UPSERT/DELETE changes against the in-memory
+// record set and rewrites the zonefile. Zonefile writes are synchronous, so
+// it always returns an empty change id.
+func (p *BindProvider) ApplyChanges(zoneID string, changes []provider.Change) (string, error) {
+
+	records, err := p.ListRecords(zoneID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range changes {
+		switch c.Action {
+		case provider.ChangeActionDelete:
+			records = removeRecord(records, c.Record)
+		case provider.ChangeActionCreate, provider.ChangeActionUpsert:
+			records = upsertRecord(records, c.Record)
+		}
+	}
+
+	return "", writeZoneFile(zoneID, p.origin, records)
+}
+
+func recordKey(r provider.Record) string {
+	return r.Name + "/" + r.Type
+}
+
+func removeRecord(records []provider.Record, target provider.Record) []provider.Record {
+	var out []provider.Record
+	for _, r := range records {
+		if recordKey(r) == recordKey(target) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func upsertRecord(records []provider.Record, target provider.Record) []provider.Record {
+	for i, r := range records {
+		if recordKey(r) == recordKey(target) {
+			records[i] = target
+			return records
+		}
+	}
+	return append(records, target)
+}
+
+// writeZoneFile renders records back out as an RFC 1035 zonefile.
+func writeZoneFile(path string, origin string, records []provider.Record) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	if origin != "" {
+		fmt.Fprintf(w, "$ORIGIN %s\n", origin)
+	}
+
+	for _, r := range records {
+		for _, v := range r.Values {
+			fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", r.Name, r.TTL, r.Type, v)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,76 @@
+package bindprovider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+func TestListRecordsMergesMultiValueRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindprovider-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	zoneFile := filepath.Join(dir, "example.com.zone")
+
+	content := "$ORIGIN example.com.\n" +
+		"www.example.com.\t300\tIN\tA\t192.0.2.1\n" +
+		"www.example.com.\t300\tIN\tA\t192.0.2.2\n" +
+		"mail.example.com.\t300\tIN\tA\t192.0.2.3\n"
+
+	if err := ioutil.WriteFile(zoneFile, []byte(content), 0644); err != nil {
+		t.Fatalf("error writing test zonefile: %s", err)
+	}
+
+	p := New(zoneFile, "example.com.")
+
+	records, err := p.ListRecords(zoneFile)
+	if err != nil {
+		t.Fatalf("ListRecords returned error: %s", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 merged records, got %d: %+v", len(records), records)
+	}
+
+	var www *provider.Record
+	for i := range records {
+		if records[i].Name == "www.example.com." {
+			www = &records[i]
+		}
+	}
+	if www == nil {
+		t.Fatalf("expected a record for www.example.com., got %+v", records)
+	}
+
+	gotValues := append([]string{}, www.Values...)
+	sort.Strings(gotValues)
+	wantValues := []string{"192.0.2.1", "192.0.2.2"}
+	if !reflect.DeepEqual(gotValues, wantValues) {
+		t.Errorf("www.example.com. Values = %v, want %v", gotValues, wantValues)
+	}
+}
+
+func TestUpsertRecordReplacesAllValues(t *testing.T) {
+	existing := []provider.Record{
+		{Name: "www.example.com.", Type: "A", TTL: 300, Values: []string{"192.0.2.1", "192.0.2.2"}},
+	}
+
+	target := provider.Record{Name: "www.example.com.", Type: "A", TTL: 300, Values: []string{"192.0.2.9"}}
+
+	got := upsertRecord(existing, target)
+
+	if len(got) != 1 {
+		t.Fatalf("expected a single record after upsert, got %d: %+v", len(got), got)
+	}
+	if !reflect.DeepEqual(got[0].Values, []string{"192.0.2.9"}) {
+		t.Errorf("Values = %v, want [192.0.2.9] with no stale duplicates", got[0].Values)
+	}
+}
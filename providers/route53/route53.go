@@ -0,0 +1,475 @@
+// Package route53provider implements the provider.Provider interface against
+// AWS Route53, and exposes the Route53-only extras (health checks, resource
+// tags) that don't fit the generic interface.
+package route53provider
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+// Route53Provider implements provider.Provider against a single AWS account.
+type Route53Provider struct {
+	svc *route53.Route53
+}
+
+// New returns a Route53Provider backed by the given Route53 client.
+func New(svc *route53.Route53) *Route53Provider {
+	return &Route53Provider{svc: svc}
+}
+
+// ListZones returns every hosted zone in the account.
+func (p *Route53Provider) ListZones() ([]provider.Zone, error) {
+
+	var zones []provider.Zone
+
+	f := func(resp *route53.ListHostedZonesOutput, lastPage bool) (shouldContinue bool) {
+		for _, zone := range resp.HostedZones {
+			zones = append(zones, provider.Zone{
+				ID:   stripHostedZonePrefix(aws.StringValue(zone.Id)),
+				Name: aws.StringValue(zone.Name),
+			})
+		}
+		return true
+	}
+
+	err := p.svc.ListHostedZonesPages(&route53.ListHostedZonesInput{}, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// ZoneIDByName looks up a hosted zone's id from its name. This is a
+// Route53-specific convenience used when a YAML config omits ZoneID.
+func (p *Route53Provider) ZoneIDByName(name string) (string, error) {
+
+	listParams := &route53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(name),
+		MaxItems: aws.String("1"),
+	}
+	hzOut, err := p.svc.ListHostedZonesByName(listParams)
+	if err != nil {
+		return "", err
+	}
+
+	zones := hzOut.HostedZones
+	if len(zones) < 1 {
+		return "", fmt.Errorf("no zone found for %s", name)
+	}
+
+	zoneID := *zones[0].Id
+	zoneName := *zones[0].Name
+
+	// Safety check because sometimes the first row is not the same hosted zone
+	// you are looking for, but rather the first zone that is found, and if the
+	// zone does not exist this would otherwise silently return the nearest zone
+	if zoneName != name {
+		return "", fmt.Errorf("hosted zone names do not match: [%s] - [%s]", name, zoneName)
+	}
+
+	return stripHostedZonePrefix(zoneID), nil
+}
+
+// ListRecords returns every resourcerecordset in the zone, paginating as needed.
+func (p *Route53Provider) ListRecords(zoneID string) ([]provider.Record, error) {
+
+	req := route53.ListResourceRecordSetsInput{
+		HostedZoneId: &zoneID,
+	}
+
+	var records []provider.Record
+
+	for {
+		resp, err := p.svc.ListResourceRecordSets(&req)
+		if err != nil {
+			return nil, err
+		}
+		for _, rrset := range resp.ResourceRecordSets {
+			records = append(records, toRecord(rrset))
+		}
+		if aws.BoolValue(resp.IsTruncated) {
+			req.StartRecordName = resp.NextRecordName
+			req.StartRecordType = resp.NextRecordType
+			req.StartRecordIdentifier = resp.NextRecordIdentifier
+		} else {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// ApplyChanges submits a batch of changes to the zone via ChangeResourceRecordSets
+// and returns the AWS change id, which WaitForChange can poll on.
+func (p *Route53Provider) ApplyChanges(zoneID string, changes []provider.Change) (string, error) {
+
+	var rrChanges []*route53.Change
+	for _, c := range changes {
+		rrChanges = append(rrChanges, &route53.Change{
+			Action:            aws.String(string(c.Action)),
+			ResourceRecordSet: toResourceRecordSet(c.Record),
+		})
+	}
+
+	params := &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: rrChanges,
+			Comment: aws.String("Zone Changes"),
+		},
+		HostedZoneId: aws.String(zoneID),
+	}
+
+	resp, err := p.svc.ChangeResourceRecordSets(params)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("Changes Submitted to AWS:")
+	fmt.Printf("Comment:      %s \n", aws.StringValue(resp.ChangeInfo.Comment))
+	fmt.Printf("ID:           %s \n", aws.StringValue(resp.ChangeInfo.Id))
+	fmt.Printf("Status:       %s \n", aws.StringValue(resp.ChangeInfo.Status))
+	fmt.Printf("Submitted At: %s \n", aws.TimeValue(resp.ChangeInfo.SubmittedAt))
+
+	return aws.StringValue(resp.ChangeInfo.Id), nil
+}
+
+// maxWaitForChangeAttempts bounds WaitForChange's polling loop so a change
+// that never reaches INSYNC (propagation hiccup, throttled account) fails
+// loudly instead of hanging a CI job forever. 60 attempts at 5s apiece is 5
+// minutes, matching the cap the AWS CLI/Terraform use for this same wait.
+const maxWaitForChangeAttempts = 60
+
+// WaitForChange polls GetChange until the change reaches INSYNC, so callers
+// can serialize dependent batches the way -wait requires. It gives up after
+// maxWaitForChangeAttempts and returns an error rather than blocking forever.
+func (p *Route53Provider) WaitForChange(changeID string) error {
+	for attempt := 0; attempt < maxWaitForChangeAttempts; attempt++ {
+		resp, err := p.svc.GetChange(&route53.GetChangeInput{Id: aws.String(changeID)})
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(resp.ChangeInfo.Status) == route53.ChangeStatusInsync {
+			return nil
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return fmt.Errorf("timed out waiting for change %s to reach %s after %d attempts", changeID, route53.ChangeStatusInsync, maxWaitForChangeAttempts)
+}
+
+// toRecord converts an AWS resourcerecordset into a provider-agnostic Record.
+func toRecord(rrset *route53.ResourceRecordSet) provider.Record {
+
+	r := provider.Record{
+		Name:          aws.StringValue(rrset.Name),
+		Type:          aws.StringValue(rrset.Type),
+		TTL:           aws.Int64Value(rrset.TTL),
+		SetIdentifier: aws.StringValue(rrset.SetIdentifier),
+		Weight:        rrset.Weight,
+		Region:        aws.StringValue(rrset.Region),
+		Failover:      aws.StringValue(rrset.Failover),
+		HealthCheckID: aws.StringValue(rrset.HealthCheckId),
+	}
+
+	for _, rr := range rrset.ResourceRecords {
+		r.Values = append(r.Values, aws.StringValue(rr.Value))
+	}
+
+	if rrset.AliasTarget != nil {
+		r.AliasTarget = &provider.AliasTarget{
+			HostedZoneID:         aws.StringValue(rrset.AliasTarget.HostedZoneId),
+			DNSName:              aws.StringValue(rrset.AliasTarget.DNSName),
+			EvaluateTargetHealth: aws.BoolValue(rrset.AliasTarget.EvaluateTargetHealth),
+		}
+	}
+
+	if rrset.GeoLocation != nil {
+		r.GeoLocation = &provider.GeoLocation{
+			ContinentCode:   aws.StringValue(rrset.GeoLocation.ContinentCode),
+			CountryCode:     aws.StringValue(rrset.GeoLocation.CountryCode),
+			SubdivisionCode: aws.StringValue(rrset.GeoLocation.SubdivisionCode),
+		}
+	}
+
+	return r
+}
+
+// toResourceRecordSet converts a provider-agnostic Record into the AWS wire format.
+func toResourceRecordSet(r provider.Record) *route53.ResourceRecordSet {
+
+	rrset := &route53.ResourceRecordSet{
+		Name: aws.String(r.Name),
+		Type: aws.String(r.Type),
+	}
+
+	if r.AliasTarget != nil {
+		rrset.AliasTarget = &route53.AliasTarget{
+			HostedZoneId:         aws.String(r.AliasTarget.HostedZoneID),
+			DNSName:              aws.String(r.AliasTarget.DNSName),
+			EvaluateTargetHealth: aws.Bool(r.AliasTarget.EvaluateTargetHealth),
+		}
+	} else {
+		rrset.TTL = aws.Int64(r.TTL)
+		for _, v := range r.Values {
+			value := v
+			rrset.ResourceRecords = append(rrset.ResourceRecords, &route53.ResourceRecord{Value: &value})
+		}
+	}
+
+	if r.SetIdentifier != "" {
+		rrset.SetIdentifier = aws.String(r.SetIdentifier)
+	}
+	if r.Weight != nil {
+		rrset.Weight = r.Weight
+	}
+	if r.Region != "" {
+		rrset.Region = aws.String(r.Region)
+	}
+	if r.GeoLocation != nil {
+		rrset.GeoLocation = &route53.GeoLocation{
+			ContinentCode:   aws.String(r.GeoLocation.ContinentCode),
+			CountryCode:     aws.String(r.GeoLocation.CountryCode),
+			SubdivisionCode: aws.String(r.GeoLocation.SubdivisionCode),
+		}
+	}
+	if r.Failover != "" {
+		rrset.Failover = aws.String(r.Failover)
+	}
+	if r.HealthCheckID != "" {
+		rrset.HealthCheckId = aws.String(r.HealthCheckID)
+	}
+
+	return rrset
+}
+
+// stripHostedZonePrefix removes the "/hostedzone/" path AWS prefixes zone ids with.
+func stripHostedZonePrefix(zoneID string) string {
+	return strings.TrimPrefix(zoneID, "/hostedzone/")
+}
+
+// HealthCheck is the Route53-specific health check shape, kept out of the
+// generic provider.Record since no other backend models health checks yet.
+type HealthCheck struct {
+	ID               string
+	Type             string
+	FQDN             string
+	IPAddress        string
+	Port             int64
+	ResourcePath     string
+	RequestInterval  int64
+	FailureThreshold int64
+	Regions          []string
+	SearchString     string
+	EnableSNI        bool
+}
+
+// ListHealthChecks returns every health check in the account, paginating as needed.
+func (p *Route53Provider) ListHealthChecks() ([]HealthCheck, error) {
+
+	req := route53.ListHealthChecksInput{}
+	var checks []HealthCheck
+
+	for {
+		resp, err := p.svc.ListHealthChecks(&req)
+		if err != nil {
+			return nil, err
+		}
+		for _, hc := range resp.HealthChecks {
+			checks = append(checks, toHealthCheck(hc))
+		}
+		if aws.BoolValue(resp.IsTruncated) {
+			req.Marker = resp.NextMarker
+		} else {
+			break
+		}
+	}
+
+	return checks, nil
+}
+
+func toHealthCheck(hc *route53.HealthCheck) HealthCheck {
+	c := hc.HealthCheckConfig
+
+	check := HealthCheck{
+		ID:               aws.StringValue(hc.Id),
+		Type:             aws.StringValue(c.Type),
+		FQDN:             aws.StringValue(c.FullyQualifiedDomainName),
+		IPAddress:        aws.StringValue(c.IPAddress),
+		Port:             aws.Int64Value(c.Port),
+		ResourcePath:     aws.StringValue(c.ResourcePath),
+		RequestInterval:  aws.Int64Value(c.RequestInterval),
+		FailureThreshold: aws.Int64Value(c.FailureThreshold),
+		SearchString:     aws.StringValue(c.SearchString),
+		EnableSNI:        aws.BoolValue(c.EnableSNI),
+	}
+	for _, region := range c.Regions {
+		check.Regions = append(check.Regions, aws.StringValue(region))
+	}
+
+	return check
+}
+
+func toHealthCheckConfig(hc HealthCheck) *route53.HealthCheckConfig {
+	cfg := &route53.HealthCheckConfig{
+		Type: aws.String(hc.Type),
+	}
+	if hc.FQDN != "" {
+		cfg.FullyQualifiedDomainName = aws.String(hc.FQDN)
+	}
+	if hc.IPAddress != "" {
+		cfg.IPAddress = aws.String(hc.IPAddress)
+	}
+	if hc.Port != 0 {
+		cfg.Port = aws.Int64(hc.Port)
+	}
+	if hc.ResourcePath != "" {
+		cfg.ResourcePath = aws.String(hc.ResourcePath)
+	}
+	if hc.RequestInterval != 0 {
+		cfg.RequestInterval = aws.Int64(hc.RequestInterval)
+	}
+	if hc.FailureThreshold != 0 {
+		cfg.FailureThreshold = aws.Int64(hc.FailureThreshold)
+	}
+	if hc.SearchString != "" {
+		cfg.SearchString = aws.String(hc.SearchString)
+	}
+	if hc.EnableSNI {
+		cfg.EnableSNI = aws.Bool(hc.EnableSNI)
+	}
+	for _, region := range hc.Regions {
+		cfg.Regions = append(cfg.Regions, aws.String(region))
+	}
+	return cfg
+}
+
+// CreateHealthCheck creates a new health check from the given config and
+// returns its AWS id.
+func (p *Route53Provider) CreateHealthCheck(alias string, hc HealthCheck) (string, error) {
+	params := &route53.CreateHealthCheckInput{
+		CallerReference:   aws.String(fmt.Sprintf("%s-%d", alias, time.Now().UnixNano())),
+		HealthCheckConfig: toHealthCheckConfig(hc),
+	}
+	resp, err := p.svc.CreateHealthCheck(params)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.HealthCheck.Id), nil
+}
+
+// UpdateHealthCheck pushes the configured values for an existing health check to AWS.
+// Type and RequestInterval are not sent, and neither is any field left at its
+// zero value in hc, so such a field keeps its current value in AWS.
+func (p *Route53Provider) UpdateHealthCheck(hc HealthCheck) error {
+	cfg := toHealthCheckConfig(hc)
+	params := &route53.UpdateHealthCheckInput{
+		HealthCheckId:            aws.String(hc.ID),
+		FullyQualifiedDomainName: cfg.FullyQualifiedDomainName,
+		IPAddress:                cfg.IPAddress,
+		Port:                     cfg.Port,
+		ResourcePath:             cfg.ResourcePath,
+		FailureThreshold:         cfg.FailureThreshold,
+		SearchString:             cfg.SearchString,
+		EnableSNI:                cfg.EnableSNI,
+		Regions:                  cfg.Regions,
+	}
+	_, err := p.svc.UpdateHealthCheck(params)
+	return err
+}
+
+// DeleteHealthCheck removes a health check from AWS by id.
+func (p *Route53Provider) DeleteHealthCheck(id string) error {
+	_, err := p.svc.DeleteHealthCheck(&route53.DeleteHealthCheckInput{
+		HealthCheckId: aws.String(id),
+	})
+	return err
+}
+
+// ResourceTags retrieves the tags currently applied to a hostedzone or
+// healthcheck resource, keyed by tag key.
+func (p *Route53Provider) ResourceTags(resourceType string, resourceID string) (map[string]string, error) {
+
+	resp, err := p.svc.ListTagsForResource(&route53.ListTagsForResourceInput{
+		ResourceType: aws.String(resourceType),
+		ResourceId:   aws.String(resourceID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, t := range resp.ResourceTagSet.Tags {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	return tags, nil
+}
+
+// ReconcileTags computes the add/remove diff between the desired tags and the
+// tags currently on a hostedzone or healthcheck resource and submits it via
+// ChangeTagsForResource. A nil desired map means "don't manage tags for this
+// resource" and is a no-op; a config that wants to clear every tag must set
+// an empty, non-nil map.
+func (p *Route53Provider) ReconcileTags(resourceType string, resourceID string, desired map[string]string) error {
+
+	if desired == nil {
+		return nil
+	}
+
+	existing, err := p.ResourceTags(resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+
+	addKV, removeKeys := diffTags(desired, existing)
+	if len(addKV) == 0 && len(removeKeys) == 0 {
+		return nil
+	}
+
+	var addTags []*route53.Tag
+	for k, v := range addKV {
+		addTags = append(addTags, &route53.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	var removeTagKeys []*string
+	for _, k := range removeKeys {
+		removeTagKeys = append(removeTagKeys, aws.String(k))
+	}
+
+	_, err = p.svc.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceType:  aws.String(resourceType),
+		ResourceId:    aws.String(resourceID),
+		AddTags:       addTags,
+		RemoveTagKeys: removeTagKeys,
+	})
+	return err
+}
+
+// diffTags compares desired against existing and reports which keys need to
+// be added or changed (addKV) and which existing keys are no longer wanted
+// (removeKeys). It's split out from ReconcileTags so the diff itself can be
+// unit tested without an AWS client.
+func diffTags(desired map[string]string, existing map[string]string) (map[string]string, []string) {
+
+	addKV := make(map[string]string)
+	for k, v := range desired {
+		if existing[k] != v {
+			addKV[k] = v
+		}
+	}
+
+	var removeKeys []string
+	for k := range existing {
+		if _, ok := desired[k]; !ok {
+			removeKeys = append(removeKeys, k)
+		}
+	}
+
+	return addKV, removeKeys
+}
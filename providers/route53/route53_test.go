@@ -0,0 +1,69 @@
+package route53provider
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffTags(t *testing.T) {
+	cases := []struct {
+		name       string
+		desired    map[string]string
+		existing   map[string]string
+		wantAdd    map[string]string
+		wantRemove []string
+	}{
+		{
+			name:       "new key is added",
+			desired:    map[string]string{"env": "prod"},
+			existing:   map[string]string{},
+			wantAdd:    map[string]string{"env": "prod"},
+			wantRemove: nil,
+		},
+		{
+			name:       "changed value is re-added",
+			desired:    map[string]string{"env": "prod"},
+			existing:   map[string]string{"env": "staging"},
+			wantAdd:    map[string]string{"env": "prod"},
+			wantRemove: nil,
+		},
+		{
+			name:       "unchanged key is left alone",
+			desired:    map[string]string{"env": "prod"},
+			existing:   map[string]string{"env": "prod"},
+			wantAdd:    map[string]string{},
+			wantRemove: nil,
+		},
+		{
+			name:       "key missing from desired is removed",
+			desired:    map[string]string{},
+			existing:   map[string]string{"env": "prod"},
+			wantAdd:    map[string]string{},
+			wantRemove: []string{"env"},
+		},
+		{
+			name:       "empty but non-nil desired clears every existing tag",
+			desired:    map[string]string{},
+			existing:   map[string]string{"env": "prod", "team": "dns"},
+			wantAdd:    map[string]string{},
+			wantRemove: []string{"env", "team"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gotAdd, gotRemove := diffTags(c.desired, c.existing)
+
+			if !reflect.DeepEqual(gotAdd, c.wantAdd) {
+				t.Errorf("addKV = %v, want %v", gotAdd, c.wantAdd)
+			}
+
+			sort.Strings(gotRemove)
+			sort.Strings(c.wantRemove)
+			if !reflect.DeepEqual(gotRemove, c.wantRemove) {
+				t.Errorf("removeKeys = %v, want %v", gotRemove, c.wantRemove)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ package main
 // author: Randall Svancara
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -13,9 +14,11 @@ import (
 
 	"text/tabwriter"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/rsvancara/aws-route53/provider"
+	"github.com/rsvancara/aws-route53/providers/bind"
+	"github.com/rsvancara/aws-route53/providers/route53"
 	"gopkg.in/yaml.v2"
 )
 
@@ -25,14 +28,65 @@ var path string
 var build bool
 var all bool
 var override bool
+var tagsOnly bool
+var pruneHealthChecks bool
+var syncUnreferencedHealthChecks bool
+var providerName string
+var dryRun bool
+var outputFormat string
+var detailedExitcode bool
+var wait bool
+var ddns bool
+var ddnsName string
+var ddnsType string
+var ddnsTTL int64
+var ddnsZoneID string
+var ddnsResolver string
+var ddnsInterval string
+var ddnsJitter string
+var ddnsOnce bool
+var ddnsStateFile string
+
+// Route53's ChangeResourceRecordSets enforces a limit of 1000 changes and
+// 32000 characters of changed values per batch; changes in excess of either
+// limit must be submitted as separate, sequential batches.
+const maxBatchItems = 1000
+const maxBatchChars = 32000
 
 // Represents a route53Zone configuration
 type route53Zone struct {
 	Name               string              `yaml:"Name"`
 	ZoneID             string              `yaml:"ZoneID"`
+	Tags               map[string]string   `yaml:"Tags,omitempty"`
+	HealthChecks       []healthCheckConfig `yaml:"HealthChecks,omitempty"`
 	ResourceRecordSets []resourceRecordSet `yaml:"ResourceRecordSets"`
 }
 
+// Represents a route53 health check configuration. Only the endpoint settings
+// used by HTTP, HTTPS and TCP checks are modelled: there are no fields for the
+// child health checks of a CALCULATED check or the alarm of a CLOUDWATCH
+// check, so neither is sent to AWS. Route53-only: other providers don't model
+// health checks yet.
+type healthCheckConfig struct {
+	// ID is the AWS health check id. Left blank for a new health check;
+	// populated by reconcileHealthChecks once created.
+	ID   string            `yaml:"ID,omitempty"`
+	Tags map[string]string `yaml:"Tags,omitempty"`
+	// Alias is a local name used by resourceRecordSet.HealthCheck to reference
+	// this health check without hard-coding its AWS id.
+	Alias            string   `yaml:"Alias"`
+	Type             string   `yaml:"Type"`
+	FQDN             string   `yaml:"FQDN,omitempty"`
+	IPAddress        string   `yaml:"IPAddress,omitempty"`
+	Port             int64    `yaml:"Port,omitempty"`
+	ResourcePath     string   `yaml:"ResourcePath,omitempty"`
+	RequestInterval  int64    `yaml:"RequestInterval,omitempty"`
+	FailureThreshold int64    `yaml:"FailureThreshold,omitempty"`
+	Regions          []string `yaml:"Regions,omitempty"`
+	SearchString     string   `yaml:"SearchString,omitempty"`
+	EnableSNI        bool     `yaml:"EnableSNI,omitempty"`
+}
+
 // Represents a route53 aliasTarget configuration
 type aliasTarget struct {
 	HostedZoneID         string `yaml:"HostedZoneID"`
@@ -61,6 +115,13 @@ type resourceRecords struct {
 	Value string `yaml:"Value"`
 }
 
+// Represents a route53 geoLocation routing configuration
+type geoLocation struct {
+	ContinentCode   string `yaml:"ContinentCode,omitempty"`
+	CountryCode     string `yaml:"CountryCode,omitempty"`
+	SubdivisionCode string `yaml:"SubdivisionCode,omitempty"`
+}
+
 // Represents resource recordset configuration
 type resourceRecordSet struct {
 	TTL             int64             `yaml:"TTL"`
@@ -68,6 +129,115 @@ type resourceRecordSet struct {
 	Type            string            `yaml:"Type"`
 	AliasTarget     aliasTarget       `yaml:"AliasTarget,omitempty"`
 	ResourceRecords []resourceRecords `yaml:"ResourceRecords,omitempty"`
+
+	// Routing policy fields. SetIdentifier distinguishes multiple resourcerecordsets
+	// that share the same Name/Type when a routing policy is in use, and must be
+	// unique among those records. At most one of Weight, Region, GeoLocation or
+	// Failover should be set per the Route53 API. Backends other than Route53
+	// ignore these.
+	SetIdentifier string      `yaml:"SetIdentifier,omitempty"`
+	Weight        *int64      `yaml:"Weight,omitempty"`
+	Region        string      `yaml:"Region,omitempty"`
+	GeoLocation   geoLocation `yaml:"GeoLocation,omitempty"`
+	Failover      string      `yaml:"Failover,omitempty"`
+	HealthCheckID string      `yaml:"HealthCheckId,omitempty"`
+
+	// HealthCheck references a healthCheckConfig.Alias from the zone's
+	// HealthChecks list. getChange resolves it to a HealthCheckId; if both
+	// HealthCheck and HealthCheckID are set, HealthCheckID takes precedence.
+	HealthCheck string `yaml:"HealthCheck,omitempty"`
+}
+
+// recordKey uniquely identifies a resourcerecordset for diffing purposes.
+// Route53 allows multiple records sharing a Name/Type when a routing policy
+// (weighted, latency, geo or failover) is in use, distinguished by SetIdentifier.
+type recordKey struct {
+	Name          string
+	Type          string
+	SetIdentifier string
+}
+
+// key returns the (Name, Type, SetIdentifier) identity of a config recordset.
+func (rr *resourceRecordSet) key() recordKey {
+	return recordKey{Name: rr.Name, Type: rr.Type, SetIdentifier: rr.SetIdentifier}
+}
+
+// providerRecordKey returns the (Name, Type, SetIdentifier) identity of a
+// provider-agnostic Record.
+func providerRecordKey(r provider.Record) recordKey {
+	return recordKey{Name: r.Name, Type: r.Type, SetIdentifier: r.SetIdentifier}
+}
+
+// recordsEqual reports whether desired and current describe the same record
+// state, so deltaBuilder can skip an UPSERT when nothing would actually
+// change. It compares TTL, ResourceRecords values (order-insensitive), the
+// AliasTarget and the routing-policy fields; Name/Type/SetIdentifier are
+// assumed equal already, since that's how the two records were matched.
+func recordsEqual(desired *provider.Record, current *provider.Record) bool {
+	if desired.TTL != current.TTL {
+		return false
+	}
+	if !stringSlicesEqualUnordered(desired.Values, current.Values) {
+		return false
+	}
+	if !aliasTargetsEqual(desired.AliasTarget, current.AliasTarget) {
+		return false
+	}
+	if desired.Weight == nil || current.Weight == nil {
+		if desired.Weight != current.Weight {
+			return false
+		}
+	} else if *desired.Weight != *current.Weight {
+		return false
+	}
+	if desired.Region != current.Region {
+		return false
+	}
+	if !geoLocationsEqual(desired.GeoLocation, current.GeoLocation) {
+		return false
+	}
+	if desired.Failover != current.Failover {
+		return false
+	}
+	if desired.HealthCheckID != current.HealthCheckID {
+		return false
+	}
+	return true
+}
+
+// stringSlicesEqualUnordered reports whether a and b contain the same values,
+// ignoring order; Route53 does not guarantee ResourceRecords ordering.
+func stringSlicesEqualUnordered(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		counts[v]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func aliasTargetsEqual(a *provider.AliasTarget, b *provider.AliasTarget) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func geoLocationsEqual(a *provider.GeoLocation, b *provider.GeoLocation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 // Initializing command line
@@ -77,6 +247,24 @@ func init() {
 	flag.StringVar(&path, "p", "", "path to generate configuration files")
 	flag.BoolVar(&override, "o", false, "erase the existing configuration and create a new one")
 	flag.BoolVar(&all, "a", false, "build all configurations for an entire route53 account")
+	flag.BoolVar(&tagsOnly, "tags-only", false, "only synchronize tags on the hosted zone and health checks, do not touch records")
+	flag.BoolVar(&pruneHealthChecks, "prune-health-checks", false, "delete account-wide health checks not present in this zone's HealthChecks list; health checks are account-wide, so this is dangerous if a zone's config file only lists a subset of the account's health checks")
+	flag.BoolVar(&syncUnreferencedHealthChecks, "sync-unreferenced-health-checks", false, "create/update every health check in this zone's HealthChecks list, not just the ones its ResourceRecordSets reference; health checks are account-wide, so this risks pushing a stale point-in-time snapshot from one zone's config back over changes made via another zone")
+	flag.StringVar(&providerName, "provider", "route53", "DNS provider backend to use: route53 or bind")
+	flag.BoolVar(&dryRun, "dry-run", false, "compute the change batch and print it without applying it (a.k.a. plan)")
+	flag.StringVar(&outputFormat, "output", "text", "output format for -dry-run: text or json")
+	flag.BoolVar(&detailedExitcode, "detailed-exitcode", false, "exit 2 if there is drift, 0 if none, 1 on error (Terraform convention); implies -dry-run")
+	flag.BoolVar(&wait, "wait", false, "wait for each change batch to propagate (provider permitting) before submitting the next")
+	flag.BoolVar(&ddns, "ddns", false, "run in dynamic-DNS mode, upserting a record to the host's current public IP")
+	flag.StringVar(&ddnsName, "ddns-name", "", "record name to keep pointed at the current public IP")
+	flag.StringVar(&ddnsType, "ddns-type", "A", "record type for -ddns: A or AAAA")
+	flag.Int64Var(&ddnsTTL, "ddns-ttl", 300, "record TTL for -ddns")
+	flag.StringVar(&ddnsZoneID, "ddns-zoneid", "", "hosted zone id for -ddns")
+	flag.StringVar(&ddnsResolver, "ddns-resolver", "https://checkip.amazonaws.com", "URL returning the host's public IP as plain text")
+	flag.StringVar(&ddnsInterval, "ddns-interval", "5m", "poll interval for -ddns, as a time.Duration string")
+	flag.StringVar(&ddnsJitter, "ddns-jitter", "30s", "maximum random jitter added to each -ddns poll interval, as a time.Duration string")
+	flag.BoolVar(&ddnsOnce, "ddns-once", false, "check and update once, then exit; for driving -ddns from cron instead of a long-running poll loop")
+	flag.StringVar(&ddnsStateFile, "ddns-state", "route53-ddns.state", "path to the file that persists the last-applied IP across restarts")
 }
 
 // Main function
@@ -84,6 +272,11 @@ func main() {
 
 	flag.Parse()
 
+	if ddns {
+		runDDNS()
+		return
+	}
+
 	if all == false {
 		if config == "" {
 			fmt.Println(fmt.Errorf("incomplete arguments: c: %s", config))
@@ -100,22 +293,7 @@ func main() {
 		}
 	}
 
-	// One way to create a session...
-	//sess, err := session.NewSession(&aws.Config{
-	//	Region: aws.String("us-west-2")})
-
-	// A little better way to create a session
-	sess, err := session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	})
-
-	if err != nil {
-		log.Fatalf("failed to create session, %s", err)
-	}
-
-	svc := route53.New(sess)
-
-	// if build is false, then we synchronize the configuration to AWS
+	// if build is false, then we synchronize the configuration to the provider
 	if build == false {
 
 		if fileExists(config) != true {
@@ -129,20 +307,59 @@ func main() {
 			log.Fatal("Error reading the configuration file")
 		}
 
-		deltaBuilder(svc, zoneConfig)
+		prov, r53 := newProvider(providerName, zoneConfig)
+		deltaBuilder(prov, r53, zoneConfig)
 	}
 
-	// if the build is true, then synchronize the configuration to a configuration file
+	// if the build is true, then synchronize the provider to a configuration file.
+	// Only route53 can enumerate every zone in an account, so -b/-a require it.
 	if build == true {
 
-		configBuildAllConfigs(svc, path)
+		if providerName != "route53" {
+			log.Fatalf("-b/-a build mode is only supported with -provider route53")
+		}
+
+		sess, err := newAWSSession()
+		if err != nil {
+			log.Fatalf("failed to create session, %s", err)
+		}
+
+		configBuildAllConfigs(route53provider.New(route53.New(sess)), path)
 	}
 
 }
 
+// newAWSSession creates a shared-config AWS session for talking to Route53.
+func newAWSSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// newProvider builds the provider.Provider backend named by name. It also
+// returns the concrete Route53Provider when name is "route53", since health
+// checks and tags are Route53-only features that sit outside provider.Provider;
+// r53 is nil for any other backend.
+func newProvider(name string, zoneConfig *route53Zone) (provider.Provider, *route53provider.Route53Provider) {
+	switch name {
+	case "route53":
+		sess, err := newAWSSession()
+		if err != nil {
+			log.Fatalf("failed to create session, %s", err)
+		}
+		r53 := route53provider.New(route53.New(sess))
+		return r53, r53
+	case "bind":
+		return bindprovider.New(zoneConfig.ZoneID, zoneConfig.Name), nil
+	default:
+		log.Fatalf("unknown provider %s", name)
+		return nil, nil
+	}
+}
+
 // Print the formatted summary to display at the end of the command
 // execution for summary purposes.  Describes what changed.
-func printReport(changes []*route53.Change, zoneName string) {
+func printReport(changes []provider.Change, zoneName string) {
 	fmt.Println("*********************************************")
 	fmt.Printf("Proposed Changes for Zone %s:\n", zoneName)
 	fmt.Println("*********************************************")
@@ -151,9 +368,7 @@ func printReport(changes []*route53.Change, zoneName string) {
 	fmt.Fprintln(w, "ACTION\tNAME\tTYPE")
 
 	for _, change := range changes {
-		fmt.Fprintln(w, fmt.Sprintf("%s\t%s\t%s", aws.StringValue(change.Action),
-			aws.StringValue(change.ResourceRecordSet.Name),
-			aws.StringValue(change.ResourceRecordSet.Type)))
+		fmt.Fprintln(w, fmt.Sprintf("%s\t%s\t%s", change.Action, change.Record.Name, change.Record.Type))
 	}
 	w.Flush()
 	fmt.Printf("\n\n")
@@ -178,30 +393,6 @@ func readConfig(config string) (*route53Zone, error) {
 	return &r, nil
 }
 
-// Takes an array of route53.Change types and submits it to AWS.
-// Returns an error if there is a failure
-func createResourceRecordSetChange(svc *route53.Route53, zone string, changes []*route53.Change) error {
-	params := &route53.ChangeResourceRecordSetsInput{
-		ChangeBatch: &route53.ChangeBatch{ // Required
-			Changes: changes,
-			Comment: aws.String("Zone Changes"),
-		},
-		HostedZoneId: aws.String(zone), // Required
-	}
-	resp, err := svc.ChangeResourceRecordSets(params)
-	if err != nil {
-		return err
-	}
-
-	// Pretty-print the response data.
-	fmt.Println("Changes Submitted to AWS:")
-	fmt.Printf("Comment:     %s \n", aws.StringValue(resp.ChangeInfo.Comment))
-	fmt.Printf("ID:          %s \n", aws.StringValue(resp.ChangeInfo.Id))
-	fmt.Printf("Status:      %s \n", aws.StringValue(resp.ChangeInfo.Status))
-	fmt.Printf("Submitted At: %s \n", aws.TimeValue(resp.ChangeInfo.SubmittedAt))
-	return nil
-}
-
 // Test if a file exists, used to validate configuration file exists
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
@@ -214,308 +405,505 @@ func fileExists(filename string) bool {
 }
 
 // Find resourcerecords that can be deleted.  These are the records that are NOT
-// in the configuration but do exist in the route53 zone
-func findRecordsToDelete(configrr *route53Zone, awsrr []*route53.ResourceRecordSet) []*route53.Change {
+// in the configuration but do exist in the provider's zone
+func findRecordsToDelete(configrr *route53Zone, providerrr []provider.Record) []provider.Change {
 
-	var diff []*route53.Change
-	len1 := len(awsrr)
+	var diff []provider.Change
 	len2 := len(configrr.ResourceRecordSets)
 
-	for i := 1; i < len1; i++ {
-		var j int
-		for j = 0; j < len2; j++ {
-			// Ignore NS records, please do not delete these
-			if aws.StringValue(awsrr[i].Type) == "NS" || aws.StringValue(awsrr[i].Type) == "SOA" {
-				break
-			}
-			// Find a match, short circuit and go to the next iteration
-			if configrr.ResourceRecordSets[j].Name == aws.StringValue(awsrr[i].Name) &&
-				configrr.ResourceRecordSets[j].Type == aws.StringValue(awsrr[i].Type) {
+	for i := range providerrr {
+		// Ignore NS/SOA records, please do not delete these, even when the
+		// config has no ResourceRecordSets at all (e.g. a zone managed purely
+		// for tags/health checks)
+		if providerrr[i].Type == "NS" || providerrr[i].Type == "SOA" {
+			continue
+		}
+
+		found := false
+		for j := 0; j < len2; j++ {
+			if configrr.ResourceRecordSets[j].key() == providerRecordKey(providerrr[i]) {
+				found = true
 				break
 			}
 		}
-		if j == len2 {
-			diff = append(diff, &route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: awsrr[i]})
+		if !found {
+			diff = append(diff, provider.Change{Action: provider.ChangeActionDelete, Record: providerrr[i]})
 		}
 	}
 
 	return diff
 }
 
-// Find records that can be added.  These are records that are in the Cconfiguration
-// but not in the route53 zone
-func findRecordsToAdd(configrr *route53Zone, awsrr []*route53.ResourceRecordSet) []*route53.Change {
+// Find records that can be added.  These are records that are in the configuration
+// but not in the provider's zone
+func findRecordsToAdd(configrr *route53Zone, providerrr []provider.Record, healthChecks map[string]string) []provider.Change {
 
-	var diff []*route53.Change
+	var diff []provider.Change
 	len1 := len(configrr.ResourceRecordSets)
-	len2 := len(awsrr)
+	len2 := len(providerrr)
 
-	for i := 1; i < len1; i++ {
+	for i := 0; i < len1; i++ {
 		var j int
 		for j = 0; j < len2; j++ {
 			// Find a match, short circuit and go to the next iteration
-			if configrr.ResourceRecordSets[i].Name == aws.StringValue(awsrr[j].Name) &&
-				configrr.ResourceRecordSets[i].Type == aws.StringValue(awsrr[j].Type) {
+			if configrr.ResourceRecordSets[i].key() == providerRecordKey(providerrr[j]) {
 				break
 			}
 		}
 		if j == len2 {
-			change, err := getChange("CREATE", &configrr.ResourceRecordSets[i])
+			change, err := getChange(provider.ChangeActionCreate, &configrr.ResourceRecordSets[i], healthChecks)
 			if err != nil {
 				log.Fatalf("Error getting change will adding recordset %s with error: %s ",
 					configrr.ResourceRecordSets[i].Name, err)
 			}
-			diff = append(diff, change)
+			diff = append(diff, *change)
 		}
 	}
 
 	return diff
 }
 
-// Generate the route53.Change object from the config
-func getChange(changeType string, configrr *resourceRecordSet) (*route53.Change, error) {
+// applyRoutingPolicy copies the routing-policy fields from the config recordset
+// onto the provider.Record being built for a change. At most one of Weight,
+// Region, GeoLocation or Failover should be set, per the Route53 API.
+// healthChecks maps a healthCheckConfig.Alias to its AWS health check id so
+// resourceRecordSet.HealthCheck references can be resolved.
+func applyRoutingPolicy(configrr *resourceRecordSet, rec *provider.Record, healthChecks map[string]string) {
+	rec.SetIdentifier = configrr.SetIdentifier
+	rec.Weight = configrr.Weight
+	rec.Region = configrr.Region
+	if configrr.GeoLocation != (geoLocation{}) {
+		rec.GeoLocation = &provider.GeoLocation{
+			ContinentCode:   configrr.GeoLocation.ContinentCode,
+			CountryCode:     configrr.GeoLocation.CountryCode,
+			SubdivisionCode: configrr.GeoLocation.SubdivisionCode,
+		}
+	}
+	rec.Failover = configrr.Failover
 
-	var changeRR []*route53.ResourceRecord
+	switch {
+	case configrr.HealthCheckID != "":
+		rec.HealthCheckID = configrr.HealthCheckID
+	case configrr.HealthCheck != "":
+		if id, ok := healthChecks[configrr.HealthCheck]; ok {
+			rec.HealthCheckID = id
+		} else {
+			log.Fatalf("Error resolving health check alias %s for record %s: no such health check",
+				configrr.HealthCheck, configrr.Name)
+		}
+	}
+}
+
+// Generate the provider.Change object from the config
+func getChange(action provider.ChangeAction, configrr *resourceRecordSet, healthChecks map[string]string) (*provider.Change, error) {
+
+	rec := provider.Record{
+		Name: configrr.Name,
+		Type: configrr.Type,
+	}
 
 	if configrr.ResourceRecords != nil {
+		rec.TTL = configrr.TTL
 		for _, trr := range configrr.ResourceRecords {
-			value := trr.Value
-			changeRR = append(changeRR, &route53.ResourceRecord{Value: &value})
-		}
-		var change = route53.Change{
-			Action: aws.String(changeType), // Required
-			ResourceRecordSet: &route53.ResourceRecordSet{ // Required
-				Name:            aws.String(configrr.Name), // Required
-				Type:            aws.String(configrr.Type), // Required
-				TTL:             aws.Int64(300),
-				ResourceRecords: changeRR,
-			},
+			rec.Values = append(rec.Values, trr.Value)
 		}
+		applyRoutingPolicy(configrr, &rec, healthChecks)
 
-		return &change, nil
+		return &provider.Change{Action: action, Record: rec}, nil
 	}
 
 	if configrr.AliasTarget.getAliasDNSName() != "" {
-		//var at route53.AliasTarget
-		at := route53.AliasTarget{
-			DNSName:              aws.String(configrr.AliasTarget.DNSName),
-			HostedZoneId:         aws.String(configrr.AliasTarget.HostedZoneID),
-			EvaluateTargetHealth: aws.Bool(configrr.AliasTarget.EvaluateTargetHealth),
-		}
-		var change = route53.Change{
-			Action: aws.String(changeType), // Required
-			ResourceRecordSet: &route53.ResourceRecordSet{ // Required
-				Name:        aws.String(configrr.Name), // Required
-				Type:        aws.String(configrr.Type), // Required
-				AliasTarget: &at,
-			},
+		rec.AliasTarget = &provider.AliasTarget{
+			DNSName:              configrr.AliasTarget.DNSName,
+			HostedZoneID:         configrr.AliasTarget.HostedZoneID,
+			EvaluateTargetHealth: configrr.AliasTarget.EvaluateTargetHealth,
 		}
-		return &change, nil
+		applyRoutingPolicy(configrr, &rec, healthChecks)
+
+		return &provider.Change{Action: action, Record: rec}, nil
 	}
 
 	return nil, fmt.Errorf(fmt.Sprintf("no value was changed for record %s", configrr.Name))
 }
 
 // deltaBuilder constructs a resource record changeset based on the differences between the
-// provided configuration and the hosted zone recordset.
-func deltaBuilder(svc *route53.Route53, config *route53Zone) {
+// provided configuration and the provider's zone, then applies it. r53 is non-nil only when
+// prov is backed by Route53; it carries the health check and tag reconciliation that don't
+// fit the generic provider.Provider interface.
+func deltaBuilder(prov provider.Provider, r53 *route53provider.Route53Provider, config *route53Zone) {
+
+	var changes []provider.Change
 
-	var changes []*route53.Change
+	// -detailed-exitcode implies -dry-run: plan the change batch, report whether
+	// there was drift via the exit code, and never touch the provider or account
+	if detailedExitcode {
+		dryRun = true
+	}
 
 	if config.ZoneID == "" {
-		zoneID, err := getHostedZoneIDByNameLookup(svc, config.Name)
+		if r53 == nil {
+			log.Fatalf("ZoneID is required in the configuration for this provider")
+		}
+		zoneID, err := r53.ZoneIDByName(config.Name)
 		if err != nil {
 			log.Fatalf("Error obtaining hosted zoneid for zone %s with error %s", config.Name, err)
 		}
 		config.ZoneID = zoneID
 	}
 
+	healthChecks := make(map[string]string)
+
+	if r53 != nil {
+		if dryRun {
+			fmt.Println("(dry-run) skipping tag and health check reconciliation; not calling ChangeTagsForResource/CreateHealthCheck/UpdateHealthCheck/DeleteHealthCheck")
+		} else {
+			if err := r53.ReconcileTags(route53.TagResourceTypeHostedzone, config.ZoneID, config.Tags); err != nil {
+				log.Fatalf("Error reconciling tags for zone %s with error %s", config.Name, err)
+			}
+		}
+
+		// -tags-only syncs tags on the zone and its already-existing health checks,
+		// without creating/updating/deleting health checks or touching any records
+		if tagsOnly {
+			if !dryRun {
+				for _, hc := range config.HealthChecks {
+					if hc.ID == "" {
+						continue
+					}
+					if err := r53.ReconcileTags(route53.TagResourceTypeHealthcheck, hc.ID, hc.Tags); err != nil {
+						log.Fatalf("Error reconciling tags for health check %s with error %s", hc.Alias, err)
+					}
+				}
+			}
+			return
+		}
+
+		if dryRun {
+			// No health checks are created/updated/deleted in dry-run, so resolve
+			// HealthCheck aliases from whatever ID each one already has in the
+			// config (blank for one that doesn't exist yet) rather than reconciling
+			for _, hc := range config.HealthChecks {
+				healthChecks[hc.Alias] = hc.ID
+			}
+		} else {
+			// Reconcile health checks before the record diff runs, since resourcerecordsets
+			// may reference a health check by alias
+			hc, err := reconcileHealthChecks(r53, config)
+			if err != nil {
+				log.Fatalf("Error reconciling health checks for zone %s with error %s", config.Name, err)
+			}
+			healthChecks = hc
+		}
+	} else if tagsOnly {
+		log.Fatalf("-tags-only is only supported with -provider route53")
+	}
+
 	// Obtain the current records for the zone in the provided configuration
-	records, err := listAllRecordSets(svc, config.ZoneID)
+	records, err := prov.ListRecords(config.ZoneID)
 	if err != nil {
 		log.Fatalf("Error obtaining records for zone %s with error %s", config.Name, err)
 	}
 
 	for _, crr := range config.ResourceRecordSets {
-		found := false
-		for _, rr := range records {
-			if crr.Name == aws.StringValue(rr.Name) && crr.Type == aws.StringValue(rr.Type) {
-				found = true
+		var match *provider.Record
+		for i := range records {
+			if crr.key() == providerRecordKey(records[i]) {
+				match = &records[i]
 				break
 			}
 		}
-		if found == true {
-			exists := false
-			for _, change := range changes {
-				if aws.StringValue(change.ResourceRecordSet.Name) == crr.Name && aws.StringValue(change.ResourceRecordSet.Type) == crr.Type {
-					exists = true
-					break
-				}
-			}
-			if exists == false {
-				c, err := getChange("UPSERT", &crr)
-				if err != nil {
-					log.Fatalf("Error getting change to %s with error %s", crr.Name, err)
-				}
-				changes = append(changes, c)
-			}
+		if match == nil {
+			continue
 		}
+
+		c, err := getChange(provider.ChangeActionUpsert, &crr, healthChecks)
+		if err != nil {
+			log.Fatalf("Error getting change to %s with error %s", crr.Name, err)
+		}
+
+		// Only emit the UPSERT when the desired record actually differs from
+		// what the provider already has; otherwise every sync would needlessly
+		// rewrite every matched record
+		if recordsEqual(&c.Record, match) {
+			continue
+		}
+
+		changes = append(changes, *c)
 	}
 
 	deletediff := findRecordsToDelete(config, records)
 	changes = append(changes, deletediff...)
 
-	creatediff := findRecordsToAdd(config, records)
+	creatediff := findRecordsToAdd(config, records, healthChecks)
 	changes = append(changes, creatediff...)
-	printReport(changes, config.Name)
 
-	err = createResourceRecordSetChange(svc, config.ZoneID, changes)
-	if err != nil {
-		log.Fatalf("Error create resource record change with error: %s", err)
+	if dryRun {
+		printPlan(changes, config.Name)
+		if detailedExitcode {
+			if len(changes) > 0 {
+				os.Exit(2)
+			}
+			os.Exit(0)
+		}
+		return
 	}
-}
 
-// Find all the hosted zones in an AWS account
-// It returns a map of all the hosted zones
-func getHostedZones(svc *route53.Route53) (map[string]*route53.HostedZone, error) {
+	printReport(changes, config.Name)
 
-	zones := make(map[string]*route53.HostedZone)
+	waiter, canWait := prov.(provider.ChangeWaiter)
+	var changeID string
 
-	f := func(resp *route53.ListHostedZonesOutput, lastPage bool) (shouldContinue bool) {
-		for _, zone := range resp.HostedZones {
-			zones[*zone.Id] = zone
+	for i, batch := range batchChanges(changes) {
+		if i > 0 && wait && canWait {
+			if err := waiter.WaitForChange(changeID); err != nil {
+				log.Fatalf("Error waiting for change batch to propagate with error: %s", err)
+			}
 		}
-		return true
-	}
 
-	err := svc.ListHostedZonesPages(&route53.ListHostedZonesInput{}, f)
-	if err != nil {
-		return nil, err
+		id, err := prov.ApplyChanges(config.ZoneID, batch)
+		if err != nil {
+			log.Fatalf("Error applying changes with error: %s", err)
+		}
+		changeID = id
 	}
 
-	return zones, nil
+	if wait && canWait && changeID != "" {
+		if err := waiter.WaitForChange(changeID); err != nil {
+			log.Fatalf("Error waiting for change batch to propagate with error: %s", err)
+		}
+	}
 }
 
-// Obtains the RecordSets for a provided zone.
-// Returns a *route53.ListResourceRecordSetsOutput
-func getHostedZoneRecords(svc *route53.Route53, zone *string) (*route53.ListResourceRecordSetsOutput, error) {
+// batchChanges splits changes into sequential batches honoring Route53's
+// per-request limits of maxBatchItems changes and maxBatchChars of changed
+// value data; other backends simply receive every batch in turn.
+func batchChanges(changes []provider.Change) [][]provider.Change {
 
-	rrInput := &route53.ListResourceRecordSetsInput{
-		HostedZoneId: zone,
+	if len(changes) == 0 {
+		return nil
 	}
-	hostedZoneRecordSets, err := svc.ListResourceRecordSets(rrInput)
 
-	if err != nil {
-		fmt.Printf("error obtaining hosted zone %s by id:  %s", aws.StringValue(zone), err)
-		return nil, err
+	var batches [][]provider.Change
+	var current []provider.Change
+	var currentChars int
+
+	for _, c := range changes {
+		size := changeCharSize(c)
+		if len(current) > 0 && (len(current)+1 > maxBatchItems || currentChars+size > maxBatchChars) {
+			batches = append(batches, current)
+			current = nil
+			currentChars = 0
+		}
+		current = append(current, c)
+		currentChars += size
 	}
 
-	return hostedZoneRecordSets, nil
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
 }
 
-// Paginate request to get all record sets.
-func listAllRecordSets(r53 *route53.Route53, id string) (rrsets []*route53.ResourceRecordSet, err error) {
-	req := route53.ListResourceRecordSetsInput{
-		HostedZoneId: &id,
+// changeCharSize approximates the character count Route53 bills a Change
+// against the 32000 character batch limit: the record name plus every value.
+func changeCharSize(c provider.Change) int {
+	size := len(c.Record.Name)
+	for _, v := range c.Record.Values {
+		size += len(v)
+	}
+	if c.Record.AliasTarget != nil {
+		size += len(c.Record.AliasTarget.DNSName)
 	}
+	return size
+}
 
-	for {
-		var resp *route53.ListResourceRecordSetsOutput
-		resp, err = r53.ListResourceRecordSets(&req)
+// printPlan renders a planned (not yet applied) change batch in the format
+// selected by -output: "text" reuses the same tabular report as a real
+// apply, "json" emits the []provider.Change as structured JSON for CI
+// pipelines to consume.
+func printPlan(changes []provider.Change, zoneName string) {
+	switch outputFormat {
+	case "json":
+		out, err := json.MarshalIndent(changes, "", "  ")
 		if err != nil {
-			return
-		}
-		rrsets = append(rrsets, resp.ResourceRecordSets...)
-		if *resp.IsTruncated {
-			req.StartRecordName = resp.NextRecordName
-			req.StartRecordType = resp.NextRecordType
-			req.StartRecordIdentifier = resp.NextRecordIdentifier
-		} else {
-			break
+			log.Fatalf("Error serializing planned changes to JSON with error: %s", err)
 		}
+		fmt.Println(string(out))
+	default:
+		printReport(changes, zoneName)
 	}
-
-	// unescape wildcards
-	//for _, rrset := range rrsets {
-	//	rrset.Name = aws.String(unescaper.Replace(*rrset.Name))
-	//}
-
-	return
 }
 
-// Look up a hosted zone by Name
-func getHostedZoneIDByNameLookup(svc *route53.Route53, hostedZoneName string) (string, error) {
+// reconcileHealthChecks creates the health checks in config.HealthChecks that
+// have no ID yet and updates existing ones that this zone's records reference
+// (every existing one with -sync-unreferenced-health-checks). Only with
+// -prune-health-checks does it delete account health checks missing from that
+// list. It returns a map of Alias to AWS health check id so resourcerecordsets
+// can resolve their HealthCheck references.
+func reconcileHealthChecks(r53 *route53provider.Route53Provider, config *route53Zone) (map[string]string, error) {
 
-	listParams := &route53.ListHostedZonesByNameInput{
-		DNSName:  aws.String(hostedZoneName), // Required
-		MaxItems: aws.String("1"),
-	}
-	hzOut, err := svc.ListHostedZonesByName(listParams)
+	healthChecks := make(map[string]string)
+
+	existing, err := r53.ListHealthChecks()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	zones := hzOut.HostedZones
+	referenced := referencedHealthCheckAliases(config)
 
-	if len(zones) < 1 {
-		fmt.Printf("No zone found for %s\n", hostedZoneName)
-		return "", err
-	}
+	for i := range config.HealthChecks {
+		hc := &config.HealthChecks[i]
 
-	zoneID := *zones[0].Id
-	zoneName := *zones[0].Name
+		// config.HealthChecks is this one zone's view, which can be a stale,
+		// point-in-time snapshot covering the whole account (e.g. from -b -a).
+		// Pushing an existing, unreferenced entry back on an ordinary record
+		// sync would silently revert changes made to it via another zone since
+		// the snapshot was taken, so leave it alone unless this zone's records
+		// actually reference it, or -sync-unreferenced-health-checks opts in
+		if hc.ID != "" && !referenced[hc.Alias] && !referenced[hc.ID] && !syncUnreferencedHealthChecks {
+			healthChecks[hc.Alias] = hc.ID
+			continue
+		}
 
-	// Safety check because sometimes the first row is not the same hosted zone you are looking for,
-	// but rather the first zone that is found and if the zones does not exist, it will return
-	// the nearest zone which is not what you are looking for
-	if zoneName != hostedZoneName {
-		log.Fatalf("Hosted zones names do not match, quiting: [%s] - [%s]", hostedZoneName, zoneName)
+		if hc.ID == "" {
+			id, err := r53.CreateHealthCheck(hc.Alias, toProviderHealthCheck(hc))
+			if err != nil {
+				return nil, fmt.Errorf("error creating health check %s: %s", hc.Alias, err)
+			}
+			hc.ID = id
+		} else {
+			check := toProviderHealthCheck(hc)
+			check.ID = hc.ID
+			if err := r53.UpdateHealthCheck(check); err != nil {
+				return nil, fmt.Errorf("error updating health check %s: %s", hc.Alias, err)
+			}
+		}
+		if err := r53.ReconcileTags(route53.TagResourceTypeHealthcheck, hc.ID, hc.Tags); err != nil {
+			return nil, fmt.Errorf("error reconciling tags for health check %s: %s", hc.Alias, err)
+		}
+		healthChecks[hc.Alias] = hc.ID
+	}
+
+	// Health checks are account-wide, but config.HealthChecks is only this one
+	// zone's list, which is commonly a partial view (it predates this feature,
+	// or simply doesn't copy in checks referenced by other zones). Deleting
+	// anything missing from that partial view would wipe account-wide health
+	// checks on an ordinary record sync, so only do it when explicitly asked.
+	if pruneHealthChecks {
+		for _, e := range existing {
+			found := false
+			for _, hc := range config.HealthChecks {
+				if hc.ID == e.ID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				if err := r53.DeleteHealthCheck(e.ID); err != nil {
+					return nil, fmt.Errorf("error deleting health check %s: %s", e.ID, err)
+				}
+			}
+		}
 	}
 
-	// remove the /hostedzone/ path if it's there
-	if strings.HasPrefix(zoneID, "/hostedzone/") {
-		zoneID = strings.TrimPrefix(zoneID, "/hostedzone/")
+	return healthChecks, nil
+}
+
+// referencedHealthCheckAliases returns the set of healthCheckConfig.Alias or
+// ID values this zone's resourcerecordsets actually reference, via either
+// HealthCheck (alias) or HealthCheckID (direct id, as getRoute53ZoneConfig
+// round-trips it when Alias is generated equal to the AWS health check id).
+func referencedHealthCheckAliases(config *route53Zone) map[string]bool {
+	referenced := make(map[string]bool)
+	for _, rr := range config.ResourceRecordSets {
+		if rr.HealthCheck != "" {
+			referenced[rr.HealthCheck] = true
+		}
+		if rr.HealthCheckID != "" {
+			referenced[rr.HealthCheckID] = true
+		}
 	}
+	return referenced
+}
 
-	return zoneID, nil
+// toProviderHealthCheck converts a configured health check into the shape the
+// route53 provider package expects.
+func toProviderHealthCheck(hc *healthCheckConfig) route53provider.HealthCheck {
+	return route53provider.HealthCheck{
+		ID:               hc.ID,
+		Type:             hc.Type,
+		FQDN:             hc.FQDN,
+		IPAddress:        hc.IPAddress,
+		Port:             hc.Port,
+		ResourcePath:     hc.ResourcePath,
+		RequestInterval:  hc.RequestInterval,
+		FailureThreshold: hc.FailureThreshold,
+		Regions:          hc.Regions,
+		SearchString:     hc.SearchString,
+		EnableSNI:        hc.EnableSNI,
+	}
 }
 
 // Build all route53 configurations for an AWS account
-func configBuildAllConfigs(svc *route53.Route53, path string) {
+func configBuildAllConfigs(r53 *route53provider.Route53Provider, path string) {
 
 	// Make sure the path exists to the best of our ability
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		os.Mkdir(path, os.ModeDir)
 	}
 
-	zones, err := getHostedZones(svc)
+	zones, err := r53.ListZones()
 	if err != nil {
 		log.Fatalf("error obtaining hosted zones list with error: %s", err)
 	}
 
+	// Health checks are account-wide rather than per-zone; list them once and
+	// look them up per zone below
+	healthChecks, err := r53.ListHealthChecks()
+	if err != nil {
+		log.Fatalf("error obtaining health checks list with error: %s", err)
+	}
+
 	// Iterate over all the hosted zones in the account
-	for _, val := range zones {
+	for _, zone := range zones {
 
 		var config route53Zone
-		zoneID := aws.StringValue(val.Id)
-		zoneName := aws.StringValue(val.Name)
 
-		// remove the /hostedzone/ path if it's there
-		if strings.HasPrefix(zoneID, "/hostedzone/") {
-			zoneID = strings.TrimPrefix(zoneID, "/hostedzone/")
+		rrsets, err := r53.ListRecords(zone.ID)
+		if err != nil {
+			log.Fatalf("Error obtaining recordset for hosted zoneid %s with error: %s", zone.ID, err)
 		}
 
-		rrsets, err := listAllRecordSets(svc, zoneID)
+		config.Name = zone.Name
+		config.ZoneID = zone.ID
+
+		tags, err := r53.ResourceTags(route53.TagResourceTypeHostedzone, zone.ID)
 		if err != nil {
-			log.Fatalf("Error obtaining recordset for hosted zoneid %s with error: %s", zoneID, err)
+			log.Fatalf("Error obtaining tags for hosted zoneid %s with error: %s", zone.ID, err)
 		}
-
-		config.Name = zoneName
+		config.Tags = tags
 
 		fmt.Println("*****************************************")
-		fmt.Printf("Name: %s\n", zoneName)
+		fmt.Printf("Name: %s\n", zone.Name)
 		fmt.Println("*****************************************")
 
+		// Only include health checks this zone's own records reference, not
+		// every health check in the account, so a later plain record sync of
+		// this file doesn't push other zones' health checks back to AWS
+		referencedIDs := make(map[string]bool)
+		for _, rrset := range rrsets {
+			if rrset.HealthCheckID != "" {
+				referencedIDs[rrset.HealthCheckID] = true
+			}
+		}
+
+		for _, hc := range healthChecks {
+			if referencedIDs[hc.ID] {
+				getHealthCheckConfig(r53, &config, hc)
+			}
+		}
+
 		for _, rrset := range rrsets {
 
 			getRoute53ZoneConfig(&config, rrset)
@@ -529,7 +917,7 @@ func configBuildAllConfigs(svc *route53.Route53, path string) {
 		}
 
 		// Build the file path
-		filePath := path + string(os.PathSeparator) + strings.TrimSuffix(zoneName, ".") + ".yaml"
+		filePath := path + string(os.PathSeparator) + strings.TrimSuffix(zone.Name, ".") + ".yaml"
 
 		// Write the file out
 		err = ioutil.WriteFile(filePath, yamlFile, 0644)
@@ -543,38 +931,70 @@ func configBuildAllConfigs(svc *route53.Route53, path string) {
 	}
 }
 
-// maps a route53.RecordSet to a configuration object so it can be marshalled to YAML
-func getRoute53ZoneConfig(config *route53Zone, rrset *route53.ResourceRecordSet) {
+// maps a route53provider.HealthCheck to a configuration object so it can be marshalled to YAML
+func getHealthCheckConfig(r53 *route53provider.Route53Provider, config *route53Zone, hc route53provider.HealthCheck) {
+
+	tags, err := r53.ResourceTags(route53.TagResourceTypeHealthcheck, hc.ID)
+	if err != nil {
+		log.Fatalf("Error obtaining tags for health check %s with error: %s", hc.ID, err)
+	}
+
+	check := healthCheckConfig{
+		ID:               hc.ID,
+		Alias:            hc.ID,
+		Tags:             tags,
+		Type:             hc.Type,
+		FQDN:             hc.FQDN,
+		IPAddress:        hc.IPAddress,
+		Port:             hc.Port,
+		ResourcePath:     hc.ResourcePath,
+		RequestInterval:  hc.RequestInterval,
+		FailureThreshold: hc.FailureThreshold,
+		Regions:          hc.Regions,
+		SearchString:     hc.SearchString,
+		EnableSNI:        hc.EnableSNI,
+	}
+
+	config.HealthChecks = append(config.HealthChecks, check)
+}
+
+// maps a provider.Record to a configuration object so it can be marshalled to YAML
+func getRoute53ZoneConfig(config *route53Zone, rec provider.Record) {
 
 	var rr resourceRecordSet
 
 	// Ignore SOA and NS record types
-	if aws.StringValue(rrset.Type) == "SOA" || aws.StringValue(rrset.Type) == "NS" {
+	if rec.Type == "SOA" || rec.Type == "NS" {
 		return
 	}
 
-	rr.Name = aws.StringValue(rrset.Name)
-	if rrset.TTL != nil {
-		rr.TTL = aws.Int64Value(rrset.TTL)
-	}
-
-	rr.Type = aws.StringValue(rrset.Type)
+	rr.Name = rec.Name
+	rr.TTL = rec.TTL
+	rr.Type = rec.Type
 
 	// Only add AliasTarget if it exists
-	if rrset.AliasTarget != nil {
-		rr.AliasTarget.DNSName = aws.StringValue(rrset.AliasTarget.DNSName)
-		rr.AliasTarget.HostedZoneID = aws.StringValue(rrset.AliasTarget.HostedZoneId)
-		rr.AliasTarget.EvaluateTargetHealth = aws.BoolValue(rrset.AliasTarget.EvaluateTargetHealth)
+	if rec.AliasTarget != nil {
+		rr.AliasTarget.DNSName = rec.AliasTarget.DNSName
+		rr.AliasTarget.HostedZoneID = rec.AliasTarget.HostedZoneID
+		rr.AliasTarget.EvaluateTargetHealth = rec.AliasTarget.EvaluateTargetHealth
 	}
 
-	// Only add RR if it exists
-	if rrset.ResourceRecords != nil {
-		for _, rs := range rrset.ResourceRecords {
-			var recrecord resourceRecords
-			recrecord.Value = aws.StringValue(rs.Value)
-			rr.ResourceRecords = append(rr.ResourceRecords, recrecord)
+	// Round-trip routing policy fields so weighted/latency/geo/failover records
+	// survive a build -> sync cycle
+	rr.SetIdentifier = rec.SetIdentifier
+	rr.Weight = rec.Weight
+	rr.Region = rec.Region
+	if rec.GeoLocation != nil {
+		rr.GeoLocation.ContinentCode = rec.GeoLocation.ContinentCode
+		rr.GeoLocation.CountryCode = rec.GeoLocation.CountryCode
+		rr.GeoLocation.SubdivisionCode = rec.GeoLocation.SubdivisionCode
+	}
+	rr.Failover = rec.Failover
+	rr.HealthCheckID = rec.HealthCheckID
 
-		}
+	// Only add RR if it exists
+	for _, v := range rec.Values {
+		rr.ResourceRecords = append(rr.ResourceRecords, resourceRecords{Value: v})
 	}
 
 	// Finally append the RR to the configuration
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rsvancara/aws-route53/provider"
+)
+
+func TestResourceRecordSetKey(t *testing.T) {
+	cases := []struct {
+		name string
+		a    resourceRecordSet
+		b    resourceRecordSet
+		want bool
+	}{
+		{
+			name: "same name and type match",
+			a:    resourceRecordSet{Name: "www.example.com.", Type: "A"},
+			b:    resourceRecordSet{Name: "www.example.com.", Type: "A"},
+			want: true,
+		},
+		{
+			name: "different type does not match",
+			a:    resourceRecordSet{Name: "www.example.com.", Type: "A"},
+			b:    resourceRecordSet{Name: "www.example.com.", Type: "AAAA"},
+			want: false,
+		},
+		{
+			name: "same name and type but different SetIdentifier does not match",
+			a:    resourceRecordSet{Name: "www.example.com.", Type: "A", SetIdentifier: "us-east-1"},
+			b:    resourceRecordSet{Name: "www.example.com.", Type: "A", SetIdentifier: "us-west-2"},
+			want: false,
+		},
+		{
+			name: "same SetIdentifier matches",
+			a:    resourceRecordSet{Name: "www.example.com.", Type: "A", SetIdentifier: "us-east-1"},
+			b:    resourceRecordSet{Name: "www.example.com.", Type: "A", SetIdentifier: "us-east-1"},
+			want: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.a.key() == c.b.key()
+			if got != c.want {
+				t.Errorf("key() match = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestProviderRecordKeyMatchesResourceRecordSetKey(t *testing.T) {
+	rr := resourceRecordSet{Name: "www.example.com.", Type: "A", SetIdentifier: "us-east-1"}
+
+	matching := provider.Record{Name: "www.example.com.", Type: "A", SetIdentifier: "us-east-1"}
+	if rr.key() != providerRecordKey(matching) {
+		t.Errorf("expected providerRecordKey to match resourceRecordSet.key() for equivalent records")
+	}
+
+	other := provider.Record{Name: "www.example.com.", Type: "A", SetIdentifier: "us-west-2"}
+	if rr.key() == providerRecordKey(other) {
+		t.Errorf("expected providerRecordKey to distinguish records with different SetIdentifier")
+	}
+}
+
+func int64p(v int64) *int64 {
+	return &v
+}
+
+func TestRecordsEqual(t *testing.T) {
+	base := provider.Record{Name: "www.example.com.", Type: "A", TTL: 300, Values: []string{"192.0.2.1", "192.0.2.2"}}
+
+	cases := []struct {
+		name    string
+		desired provider.Record
+		current provider.Record
+		want    bool
+	}{
+		{
+			name:    "identical records are equal",
+			desired: base,
+			current: base,
+			want:    true,
+		},
+		{
+			name:    "different TTL is not equal",
+			desired: base,
+			current: provider.Record{Name: base.Name, Type: base.Type, TTL: 600, Values: base.Values},
+			want:    false,
+		},
+		{
+			name:    "values in a different order are still equal",
+			desired: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: []string{"192.0.2.2", "192.0.2.1"}},
+			current: base,
+			want:    true,
+		},
+		{
+			name:    "different values are not equal",
+			desired: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: []string{"192.0.2.9"}},
+			current: base,
+			want:    false,
+		},
+		{
+			name: "matching alias targets are equal",
+			desired: provider.Record{Name: "alias.example.com.", Type: "A",
+				AliasTarget: &provider.AliasTarget{HostedZoneID: "Z1", DNSName: "lb.example.com."}},
+			current: provider.Record{Name: "alias.example.com.", Type: "A",
+				AliasTarget: &provider.AliasTarget{HostedZoneID: "Z1", DNSName: "lb.example.com."}},
+			want: true,
+		},
+		{
+			name: "differing alias targets are not equal",
+			desired: provider.Record{Name: "alias.example.com.", Type: "A",
+				AliasTarget: &provider.AliasTarget{HostedZoneID: "Z1", DNSName: "lb.example.com."}},
+			current: provider.Record{Name: "alias.example.com.", Type: "A",
+				AliasTarget: &provider.AliasTarget{HostedZoneID: "Z2", DNSName: "lb2.example.com."}},
+			want: false,
+		},
+		{
+			name:    "matching weight is equal",
+			desired: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, Weight: int64p(10)},
+			current: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, Weight: int64p(10)},
+			want:    true,
+		},
+		{
+			name:    "differing weight is not equal",
+			desired: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, Weight: int64p(10)},
+			current: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, Weight: int64p(20)},
+			want:    false,
+		},
+		{
+			name:    "health check id drift is not equal",
+			desired: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, HealthCheckID: "hc-1"},
+			current: provider.Record{Name: base.Name, Type: base.Type, TTL: base.TTL, Values: base.Values, HealthCheckID: "hc-2"},
+			want:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := recordsEqual(&c.desired, &c.current)
+			if got != c.want {
+				t.Errorf("recordsEqual() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStringSlicesEqualUnordered(t *testing.T) {
+	cases := []struct {
+		name string
+		a    []string
+		b    []string
+		want bool
+	}{
+		{name: "both empty", a: nil, b: nil, want: true},
+		{name: "same order", a: []string{"a", "b"}, b: []string{"a", "b"}, want: true},
+		{name: "different order", a: []string{"a", "b"}, b: []string{"b", "a"}, want: true},
+		{name: "different length", a: []string{"a"}, b: []string{"a", "b"}, want: false},
+		{name: "different values", a: []string{"a", "b"}, b: []string{"a", "c"}, want: false},
+		{name: "duplicate counts matter", a: []string{"a", "a"}, b: []string{"a", "b"}, want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := stringSlicesEqualUnordered(c.a, c.b)
+			if got != c.want {
+				t.Errorf("stringSlicesEqualUnordered(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBatchChanges(t *testing.T) {
+	t.Run("no changes yields no batches", func(t *testing.T) {
+		if got := batchChanges(nil); got != nil {
+			t.Errorf("batchChanges(nil) = %v, want nil", got)
+		}
+	})
+
+	t.Run("splits batches once the item limit is exceeded", func(t *testing.T) {
+		var changes []provider.Change
+		for i := 0; i < maxBatchItems+1; i++ {
+			changes = append(changes, provider.Change{Action: provider.ChangeActionUpsert, Record: provider.Record{Name: "a.example.com.", Type: "A"}})
+		}
+
+		batches := batchChanges(changes)
+		if len(batches) != 2 {
+			t.Fatalf("expected 2 batches, got %d", len(batches))
+		}
+		if len(batches[0]) != maxBatchItems {
+			t.Errorf("first batch has %d items, want %d", len(batches[0]), maxBatchItems)
+		}
+		if len(batches[1]) != 1 {
+			t.Errorf("second batch has %d items, want 1", len(batches[1]))
+		}
+	})
+
+	t.Run("splits batches once the character limit is exceeded", func(t *testing.T) {
+		bigValue := strings.Repeat("x", maxBatchChars)
+		changes := []provider.Change{
+			{Action: provider.ChangeActionUpsert, Record: provider.Record{Name: "a.example.com.", Type: "TXT", Values: []string{bigValue}}},
+			{Action: provider.ChangeActionUpsert, Record: provider.Record{Name: "b.example.com.", Type: "TXT", Values: []string{"small"}}},
+		}
+
+		batches := batchChanges(changes)
+		if len(batches) != 2 {
+			t.Fatalf("expected 2 batches, got %d", len(batches))
+		}
+	})
+}
+
+func TestFindRecordsToDeleteKeepsApexNSAndSOAWhenConfigHasNoRecordSets(t *testing.T) {
+	config := &route53Zone{Name: "example.com.", ZoneID: "Z1"}
+
+	providerRecords := []provider.Record{
+		{Name: "example.com.", Type: "NS", Values: []string{"ns-1.awsdns.com."}},
+		{Name: "example.com.", Type: "SOA", Values: []string{"ns-1.awsdns.com. admin.example.com. 1 7200 900 1209600 86400"}},
+	}
+
+	got := findRecordsToDelete(config, providerRecords)
+	if len(got) != 0 {
+		t.Errorf("expected no deletions for apex NS/SOA with an empty config, got %+v", got)
+	}
+}